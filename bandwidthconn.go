@@ -0,0 +1,295 @@
+package delayconn
+
+import (
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Mode controls how a bandwidth-limited conn behaves when fewer tokens are
+// available in the bucket than an operation needs.
+type Mode int
+
+const (
+	// ModeShrink shrinks the operation to whatever is currently available,
+	// exposing the natural back-pressure of a slow link to the caller.
+	ModeShrink Mode = iota
+	// ModeWait blocks until enough tokens accumulate to serve the request in
+	// full, or burst bytes of it when the request is larger than burst.
+	ModeWait
+)
+
+// tokenBucket is a lazily-refilled bytes/sec token bucket shared by the
+// bandwidth-limited conn wrappers.
+type tokenBucket struct {
+	mu         sync.Mutex
+	rate       float64
+	burst      float64
+	tokens     float64
+	lastRefill time.Time
+}
+
+func newTokenBucket(rate, burst float64) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, lastRefill: time.Now()}
+}
+
+func (tb *tokenBucket) refill() {
+	now := time.Now()
+	tb.tokens += now.Sub(tb.lastRefill).Seconds() * tb.rate
+	if tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+	tb.lastRefill = now
+}
+
+// waitFor reports how long to wait for need tokens to be available, assuming
+// the bucket has already been refilled.
+func (tb *tokenBucket) waitFor(need float64) time.Duration {
+	missing := need - tb.tokens
+	if missing <= 0 {
+		return 0
+	}
+	return time.Duration(missing / tb.rate * float64(time.Second))
+}
+
+// acquire reserves up to want bytes worth of tokens, waiting if necessary.
+// Under ModeShrink it returns as soon as at least one token is available,
+// shrinking n below want rather than waiting for the full amount. want is
+// capped to the bucket's burst size, since refill never lets tokens exceed
+// burst and an uncapped want larger than burst would wait forever in
+// ModeWait. The wait is done without holding tb.mu, against dw, so it can be
+// interrupted by a SetReadDeadline/SetWriteDeadline made while the wait is in
+// flight rather than committing to a fixed sleep, and doesn't block other
+// operations on the same bucket for its whole duration. It returns
+// os.ErrDeadlineExceeded if the deadline fires before enough tokens are available.
+func (tb *tokenBucket) acquire(want int, dw *deadlineWaiter, mode Mode) (n int, err error) {
+	if burst := int(tb.burst); want > burst {
+		want = burst
+	}
+
+	for {
+		tb.mu.Lock()
+		tb.refill()
+
+		if tb.tokens >= float64(want) {
+			tb.tokens -= float64(want)
+			tb.mu.Unlock()
+			return want, nil
+		}
+
+		if mode == ModeShrink && tb.tokens >= 1 {
+			n = int(tb.tokens)
+			if n > want {
+				n = want
+			}
+			tb.tokens -= float64(n)
+			tb.mu.Unlock()
+			return n, nil
+		}
+
+		need := float64(want)
+		if mode == ModeShrink {
+			need = 1
+		}
+		wait := tb.waitFor(need)
+		tb.mu.Unlock()
+
+		if dw.wait(wait) != nil {
+			return 0, os.ErrDeadlineExceeded
+		}
+		// Tokens should now be available; loop back to claim them. Another
+		// waiter may have taken them first, in which case this goes around again.
+	}
+}
+
+// BandwidthConn wraps a net.Conn and caps both read and write throughput to
+// rate bytes/sec, allowing bursts of up to burst bytes. It composes naturally
+// with DelayConn to model both latency and bandwidth for link emulation.
+type BandwidthConn struct {
+	conn  net.Conn
+	mode  Mode
+	read  *tokenBucket
+	write *tokenBucket
+
+	readDeadline  deadlineWaiter
+	writeDeadline deadlineWaiter
+}
+
+// NewBandwidthConn creates a new BandwidthConn capped to rate bytes/sec with
+// burst bytes of allowance.
+func NewBandwidthConn(rate, burst float64, mode Mode, conn net.Conn) *BandwidthConn {
+	bc := &BandwidthConn{
+		conn:  conn,
+		mode:  mode,
+		read:  newTokenBucket(rate, burst),
+		write: newTokenBucket(rate, burst),
+	}
+	bc.readDeadline.init()
+	bc.writeDeadline.init()
+	return bc
+}
+
+// Read reads data from the connection, shrinking or waiting for bandwidth
+// tokens as configured by Mode.
+func (bc *BandwidthConn) Read(b []byte) (n int, err error) {
+	allowed, err := bc.read.acquire(len(b), &bc.readDeadline, bc.mode)
+	if err != nil {
+		return 0, &net.OpError{Op: "read", Err: err}
+	}
+	return bc.conn.Read(b[:allowed])
+}
+
+// Write writes data to the connection, shrinking or waiting for bandwidth
+// tokens as configured by Mode.
+func (bc *BandwidthConn) Write(b []byte) (n int, err error) {
+	allowed, err := bc.write.acquire(len(b), &bc.writeDeadline, bc.mode)
+	if err != nil {
+		return 0, &net.OpError{Op: "write", Err: err}
+	}
+	return bc.conn.Write(b[:allowed])
+}
+
+// Close closes the connection.
+func (bc *BandwidthConn) Close() error { return bc.conn.Close() }
+
+// LocalAddr returns the local network address.
+func (bc *BandwidthConn) LocalAddr() net.Addr { return bc.conn.LocalAddr() }
+
+// RemoteAddr returns the remote network address.
+func (bc *BandwidthConn) RemoteAddr() net.Addr { return bc.conn.RemoteAddr() }
+
+// SetDeadline sets the read and write deadlines associated with the connection.
+func (bc *BandwidthConn) SetDeadline(t time.Time) error {
+	bc.readDeadline.set(t)
+	bc.writeDeadline.set(t)
+	return bc.conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the deadline for future Read calls.
+func (bc *BandwidthConn) SetReadDeadline(t time.Time) error {
+	bc.readDeadline.set(t)
+	return bc.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline for future Write calls.
+func (bc *BandwidthConn) SetWriteDeadline(t time.Time) error {
+	bc.writeDeadline.set(t)
+	return bc.conn.SetWriteDeadline(t)
+}
+
+// ReadBandwidthConn wraps a net.Conn and caps only Read throughput to rate
+// bytes/sec, allowing bursts of up to burst bytes.
+type ReadBandwidthConn struct {
+	conn   net.Conn
+	mode   Mode
+	bucket *tokenBucket
+
+	readDeadline deadlineWaiter
+}
+
+// NewReadBandwidthConn creates a new ReadBandwidthConn capped to rate bytes/sec.
+func NewReadBandwidthConn(rate, burst float64, mode Mode, conn net.Conn) *ReadBandwidthConn {
+	rc := &ReadBandwidthConn{conn: conn, mode: mode, bucket: newTokenBucket(rate, burst)}
+	rc.readDeadline.init()
+	return rc
+}
+
+// Read reads data from the connection, shrinking or waiting for bandwidth
+// tokens as configured by Mode.
+func (rc *ReadBandwidthConn) Read(b []byte) (n int, err error) {
+	allowed, err := rc.bucket.acquire(len(b), &rc.readDeadline, rc.mode)
+	if err != nil {
+		return 0, &net.OpError{Op: "read", Err: err}
+	}
+	return rc.conn.Read(b[:allowed])
+}
+
+// Write writes data to the connection.
+func (rc *ReadBandwidthConn) Write(b []byte) (n int, err error) {
+	return rc.conn.Write(b)
+}
+
+// Close closes the connection.
+func (rc *ReadBandwidthConn) Close() error { return rc.conn.Close() }
+
+// LocalAddr returns the local network address.
+func (rc *ReadBandwidthConn) LocalAddr() net.Addr { return rc.conn.LocalAddr() }
+
+// RemoteAddr returns the remote network address.
+func (rc *ReadBandwidthConn) RemoteAddr() net.Addr { return rc.conn.RemoteAddr() }
+
+// SetDeadline sets the read and write deadlines associated with the connection.
+func (rc *ReadBandwidthConn) SetDeadline(t time.Time) error {
+	rc.readDeadline.set(t)
+	return rc.conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the deadline for future Read calls.
+func (rc *ReadBandwidthConn) SetReadDeadline(t time.Time) error {
+	rc.readDeadline.set(t)
+	return rc.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline for future Write calls.
+func (rc *ReadBandwidthConn) SetWriteDeadline(t time.Time) error {
+	return rc.conn.SetWriteDeadline(t)
+}
+
+// WriteBandwidthConn wraps a net.Conn and caps only Write throughput to rate
+// bytes/sec, allowing bursts of up to burst bytes.
+type WriteBandwidthConn struct {
+	conn   net.Conn
+	mode   Mode
+	bucket *tokenBucket
+
+	writeDeadline deadlineWaiter
+}
+
+// NewWriteBandwidthConn creates a new WriteBandwidthConn capped to rate bytes/sec.
+func NewWriteBandwidthConn(rate, burst float64, mode Mode, conn net.Conn) *WriteBandwidthConn {
+	wc := &WriteBandwidthConn{conn: conn, mode: mode, bucket: newTokenBucket(rate, burst)}
+	wc.writeDeadline.init()
+	return wc
+}
+
+// Read reads data from the connection.
+func (wc *WriteBandwidthConn) Read(b []byte) (n int, err error) {
+	return wc.conn.Read(b)
+}
+
+// Write writes data to the connection, shrinking or waiting for bandwidth
+// tokens as configured by Mode.
+func (wc *WriteBandwidthConn) Write(b []byte) (n int, err error) {
+	allowed, err := wc.bucket.acquire(len(b), &wc.writeDeadline, wc.mode)
+	if err != nil {
+		return 0, &net.OpError{Op: "write", Err: err}
+	}
+	return wc.conn.Write(b[:allowed])
+}
+
+// Close closes the connection.
+func (wc *WriteBandwidthConn) Close() error { return wc.conn.Close() }
+
+// LocalAddr returns the local network address.
+func (wc *WriteBandwidthConn) LocalAddr() net.Addr { return wc.conn.LocalAddr() }
+
+// RemoteAddr returns the remote network address.
+func (wc *WriteBandwidthConn) RemoteAddr() net.Addr { return wc.conn.RemoteAddr() }
+
+// SetDeadline sets the read and write deadlines associated with the connection.
+func (wc *WriteBandwidthConn) SetDeadline(t time.Time) error {
+	wc.writeDeadline.set(t)
+	return wc.conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the deadline for future Read calls.
+func (wc *WriteBandwidthConn) SetReadDeadline(t time.Time) error {
+	return wc.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline for future Write calls.
+func (wc *WriteBandwidthConn) SetWriteDeadline(t time.Time) error {
+	wc.writeDeadline.set(t)
+	return wc.conn.SetWriteDeadline(t)
+}
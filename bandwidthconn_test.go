@@ -0,0 +1,104 @@
+package delayconn
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBandwidthConnShrink(t *testing.T) {
+	r := bytes.NewBuffer(nil)
+	w := bytes.NewBuffer(nil)
+	rwc := &rwconn{r, w}
+
+	bc := NewBandwidthConn(10, 10, ModeShrink, rwc)
+
+	var c [1024]byte
+	n, err := bc.Write(c[:])
+	require.NoError(t, err)
+	require.Equal(t, 10, n)
+}
+
+func TestBandwidthConnWaitDeadline(t *testing.T) {
+	r := bytes.NewBuffer(nil)
+	w := bytes.NewBuffer(nil)
+	rwc := &rwconn{r, w}
+
+	bc := NewBandwidthConn(10, 10, ModeWait, rwc)
+	// Drain the initial burst so Write has to wait for a refill.
+	var drain [10]byte
+	_, err := bc.Write(drain[:])
+	require.NoError(t, err)
+	bc.SetWriteDeadline(time.Now().Add(50 * time.Millisecond))
+
+	var c [1024]byte
+	_, err = bc.Write(c[:])
+	require.Error(t, err)
+}
+
+func TestBandwidthConnWaitDeadlineSetMidWait(t *testing.T) {
+	r := bytes.NewBuffer(nil)
+	w := bytes.NewBuffer(nil)
+	rwc := &rwconn{r, w}
+
+	bc := NewBandwidthConn(1, 1, ModeWait, rwc)
+	// Drain the initial burst so Write has to wait for a refill.
+	var drain [1]byte
+	_, err := bc.Write(drain[:])
+	require.NoError(t, err)
+
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		bc.SetWriteDeadline(time.Now())
+	}()
+
+	started := time.Now()
+	var c [1024]byte
+	_, err = bc.Write(c[:])
+	elapsed := time.Since(started)
+
+	require.Error(t, err)
+	require.True(t, elapsed < 500*time.Millisecond)
+}
+
+func TestBandwidthConnWaitLargerThanBurst(t *testing.T) {
+	r := bytes.NewBuffer(nil)
+	w := bytes.NewBuffer(nil)
+	rwc := &rwconn{r, w}
+
+	bc := NewBandwidthConn(1000, 10, ModeWait, rwc)
+
+	done := make(chan struct{})
+	go func() {
+		var c [64]byte
+		bc.Write(c[:])
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Write of a buffer larger than burst never returned")
+	}
+}
+
+func TestReadBandwidthConnRefill(t *testing.T) {
+	r := bytes.NewBuffer(make([]byte, 20))
+	w := bytes.NewBuffer(nil)
+	rwc := &rwconn{r, w}
+
+	rc := NewReadBandwidthConn(100, 10, ModeShrink, rwc)
+
+	var c [1024]byte
+	n, err := rc.Read(c[:])
+	require.NoError(t, err)
+	require.Equal(t, 10, n)
+
+	time.Sleep(110 * time.Millisecond)
+
+	n, err = rc.Read(c[:])
+	require.NoError(t, err)
+	require.True(t, n > 0)
+}
@@ -0,0 +1,204 @@
+package delayconn
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Option wraps a net.Conn, returning a new net.Conn with additional fault
+// behavior applied. Options are applied in order by NewConn.
+type Option func(net.Conn) net.Conn
+
+// WithReadDelay delays every Read by d.
+func WithReadDelay(d time.Duration) Option {
+	return func(conn net.Conn) net.Conn {
+		return NewReadDelayConn(d, conn)
+	}
+}
+
+// WithWriteDelay delays every Write by d.
+func WithWriteDelay(d time.Duration) Option {
+	return func(conn net.Conn) net.Conn {
+		return NewWriteDelayConn(d, conn)
+	}
+}
+
+// WithBandwidth caps both Read and Write throughput to rate bytes/sec,
+// allowing bursts of up to burst bytes, shrinking operations that exceed the
+// available tokens.
+func WithBandwidth(rate, burst float64) Option {
+	return func(conn net.Conn) net.Conn {
+		return NewBandwidthConn(rate, burst, ModeShrink, conn)
+	}
+}
+
+// WithChunkedWrites fragments every Write into at most chunkSize-byte pieces.
+func WithChunkedWrites(chunkSize int) Option {
+	return func(conn net.Conn) net.Conn {
+		return NewChunkedWriteConn(conn, chunkSize)
+	}
+}
+
+// WithChaos applies UDP-style fault injection (loss, jitter, duplication)
+// from cfg to a stream conn. cfg.ReorderSize and cfg.ReorderHoldProbability
+// are ignored, since stream conns are ordered by definition.
+func WithChaos(cfg ChaosConfig) Option {
+	return func(conn net.Conn) net.Conn {
+		return newStreamChaosConn(cfg, conn)
+	}
+}
+
+// NewConn applies opts, in order, to conn and returns the resulting wrapped net.Conn.
+func NewConn(conn net.Conn, opts ...Option) net.Conn {
+	for _, opt := range opts {
+		conn = opt(conn)
+	}
+	return conn
+}
+
+// Dialer dials a network address and applies a chain of Options to every
+// resulting net.Conn, giving callers a drop-in replacement for net.Dialer
+// when injecting fault behavior into an http.Server, gRPC server, or
+// database driver without touching call sites.
+type Dialer struct {
+	net.Dialer
+	Options []Option
+}
+
+// NewDialer creates a new Dialer applying opts to every dialed connection.
+func NewDialer(opts ...Option) *Dialer {
+	return &Dialer{Options: opts}
+}
+
+// Dial connects to addr on the named network and applies the configured wrapper chain.
+func (d *Dialer) Dial(network, addr string) (net.Conn, error) {
+	conn, err := d.Dialer.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewConn(conn, d.Options...), nil
+}
+
+// DialContext connects to addr on the named network using ctx and applies
+// the configured wrapper chain.
+func (d *Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := d.Dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewConn(conn, d.Options...), nil
+}
+
+// Listener wraps a net.Listener and applies a chain of Options to every
+// net.Conn returned from Accept.
+type Listener struct {
+	net.Listener
+	Options []Option
+}
+
+// NewListener creates a new Listener wrapping l and applying opts to every accepted conn.
+func NewListener(l net.Listener, opts ...Option) *Listener {
+	return &Listener{Listener: l, Options: opts}
+}
+
+// Accept waits for and returns the next connection, wrapped with the configured chain.
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return NewConn(conn, l.Options...), nil
+}
+
+// streamChaosConn applies UDP-style loss, jitter, and duplication fault
+// injection to a stream net.Conn. It does not reorder, since stream conns
+// are ordered by definition.
+type streamChaosConn struct {
+	conn net.Conn
+	cfg  ChaosConfig
+	rng  *rand.Rand
+
+	mu            sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+func newStreamChaosConn(cfg ChaosConfig, conn net.Conn) *streamChaosConn {
+	return &streamChaosConn{conn: conn, cfg: cfg, rng: rand.New(rand.NewSource(cfg.Seed))}
+}
+
+// Read reads data from the connection, after the sampled jitter delay.
+func (sc *streamChaosConn) Read(b []byte) (n int, err error) {
+	sc.mu.Lock()
+	delay := sc.cfg.Jitter.sample(sc.rng)
+	deadline := sc.readDeadline
+	sc.mu.Unlock()
+
+	if delay > 0 && waitDelay(delay, deadline) {
+		return 0, &net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}
+	}
+	return sc.conn.Read(b)
+}
+
+// Write writes data to the connection, after the sampled jitter delay,
+// dropping or duplicating it per cfg.LossProbability and cfg.DupProbability.
+func (sc *streamChaosConn) Write(b []byte) (n int, err error) {
+	sc.mu.Lock()
+	delay := sc.cfg.Jitter.sample(sc.rng)
+	deadline := sc.writeDeadline
+	drop := sc.cfg.LossProbability > 0 && sc.rng.Float64() < sc.cfg.LossProbability
+	dup := sc.cfg.DupProbability > 0 && sc.rng.Float64() < sc.cfg.DupProbability
+	sc.mu.Unlock()
+
+	if delay > 0 && waitDelay(delay, deadline) {
+		return 0, &net.OpError{Op: "write", Err: os.ErrDeadlineExceeded}
+	}
+
+	if drop {
+		return len(b), nil
+	}
+
+	n, err = sc.conn.Write(b)
+	if err == nil && dup {
+		sc.conn.Write(b)
+	}
+	return n, err
+}
+
+// Close closes the connection.
+func (sc *streamChaosConn) Close() error { return sc.conn.Close() }
+
+// LocalAddr returns the local network address.
+func (sc *streamChaosConn) LocalAddr() net.Addr { return sc.conn.LocalAddr() }
+
+// RemoteAddr returns the remote network address.
+func (sc *streamChaosConn) RemoteAddr() net.Addr { return sc.conn.RemoteAddr() }
+
+// SetDeadline sets the read and write deadlines associated with the connection.
+func (sc *streamChaosConn) SetDeadline(t time.Time) error {
+	sc.mu.Lock()
+	sc.readDeadline = t
+	sc.writeDeadline = t
+	sc.mu.Unlock()
+	return sc.conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the deadline for future Read calls.
+func (sc *streamChaosConn) SetReadDeadline(t time.Time) error {
+	sc.mu.Lock()
+	sc.readDeadline = t
+	sc.mu.Unlock()
+	return sc.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline for future Write calls.
+func (sc *streamChaosConn) SetWriteDeadline(t time.Time) error {
+	sc.mu.Lock()
+	sc.writeDeadline = t
+	sc.mu.Unlock()
+	return sc.conn.SetWriteDeadline(t)
+}
@@ -0,0 +1,67 @@
+package delayconn
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewConnAppliesOption(t *testing.T) {
+	r := bytes.NewBuffer(nil)
+	w := bytes.NewBuffer(nil)
+	rwc := &rwconn{r, w}
+
+	conn := NewConn(rwc, WithChunkedWrites(4))
+
+	var c [10]byte
+	n, err := conn.Write(c[:])
+	require.Nil(t, err)
+	require.Equal(t, 4, n)
+}
+
+func TestWithChaosDropsWrites(t *testing.T) {
+	r := bytes.NewBuffer(nil)
+	w := bytes.NewBuffer(nil)
+	rwc := &rwconn{r, w}
+
+	conn := NewConn(rwc, WithChaos(ChaosConfig{Seed: 1, LossProbability: 1}))
+
+	n, err := conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.Equal(t, 5, n)
+	require.Equal(t, 0, w.Len())
+}
+
+func TestDialerAndListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	wln := NewListener(ln, WithReadDelay(10*time.Millisecond))
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := wln.Accept()
+		require.NoError(t, err)
+		accepted <- conn
+	}()
+
+	dialer := NewDialer(WithWriteDelay(10 * time.Millisecond))
+	conn, err := dialer.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	server := <-accepted
+	defer server.Close()
+
+	_, err = conn.Write([]byte("hi"))
+	require.NoError(t, err)
+
+	var b [2]byte
+	_, err = server.Read(b[:])
+	require.NoError(t, err)
+	require.Equal(t, "hi", string(b[:]))
+}
@@ -3,53 +3,77 @@ package delayconn
 
 import (
 	"io"
+	"math/rand"
 	"net"
+	"os"
+	"sync"
 	"time"
-
-	"testing/iotest"
 )
 
-// OneByteWriteConn guarantees write a one bytes every time.
-type OneByteWriteConn struct {
+// waitDelay blocks for delay, unless deadline is non-zero and would elapse
+// first, in which case it sleeps only until deadline and reports that the
+// deadline fired. A deadline already in the past returns immediately.
+func waitDelay(delay time.Duration, deadline time.Time) (deadlineExceeded bool) {
+	if deadline.IsZero() {
+		time.Sleep(delay)
+		return false
+	}
+
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		return true
+	}
+	if remaining <= delay {
+		time.Sleep(remaining)
+		return true
+	}
+
+	time.Sleep(delay)
+	return false
+}
+
+// ChunkedWriteConn writes at most chunkSize bytes per Write call.
+type ChunkedWriteConn struct {
 	w    io.Writer
 	conn net.Conn
 }
 
-// NewOneByteWriteConn creates a new OneByteWriteConn.
-func NewOneByteWriteConn(conn net.Conn) *OneByteWriteConn {
-	return &OneByteWriteConn{
+// NewChunkedWriteConn creates a new ChunkedWriteConn that writes at most
+// chunkSize bytes to conn per Write call.
+func NewChunkedWriteConn(conn net.Conn, chunkSize int) *ChunkedWriteConn {
+	return &ChunkedWriteConn{
 		conn: conn,
-		w:    OneByteWriter(conn),
+		w:    ChunkWriter(conn, chunkSize),
 	}
 }
 
-// Write Writes data from the connection.
-// Write can be made to time out and return an Error with Timeout() == true
-// after a fixed time limit; see SetDeadline and SetWriteDeadline.
-func (rc *OneByteWriteConn) Read(b []byte) (n int, err error) {
+// Read reads data from the connection.
+// Read can be made to time out and return an Error with Timeout() == true
+// after a fixed time limit; see SetDeadline and SetReadDeadline.
+func (rc *ChunkedWriteConn) Read(b []byte) (n int, err error) {
 	return rc.conn.Read(b)
 }
 
 // Write writes data to the connection.
 // Write can be made to time out and return an Error with Timeout() == true
 // after a fixed time limit; see SetDeadline and SetWriteDeadline.
-func (rc *OneByteWriteConn) Write(b []byte) (n int, err error) {
+func (rc *ChunkedWriteConn) Write(b []byte) (n int, err error) {
 	return rc.w.Write(b)
 }
 
 // Close closes the connection.
 // Any blocked Write or Write operations will be unblocked and return errors.
-func (rc *OneByteWriteConn) Close() error {
+func (rc *ChunkedWriteConn) Close() error {
 	return rc.conn.Close()
 }
 
 // LocalAddr returns the local network address.
-func (rc *OneByteWriteConn) LocalAddr() net.Addr {
+func (rc *ChunkedWriteConn) LocalAddr() net.Addr {
 	return rc.conn.LocalAddr()
 }
 
 // RemoteAddr returns the remote network address.
-func (rc *OneByteWriteConn) RemoteAddr() net.Addr {
+func (rc *ChunkedWriteConn) RemoteAddr() net.Addr {
 	return rc.conn.RemoteAddr()
 }
 
@@ -75,54 +99,64 @@ func (rc *OneByteWriteConn) RemoteAddr() net.Addr {
 // also return a timeout error. On Unix systems a keep-alive
 // failure on I/O can be detected using
 // errors.Is(err, syscall.ETIMEDOUT).
-func (rc *OneByteWriteConn) SetDeadline(t time.Time) error {
+func (rc *ChunkedWriteConn) SetDeadline(t time.Time) error {
 	return rc.conn.SetDeadline(t)
 }
 
 // SetWriteDeadline sets the deadline for future Write calls
 // and any currently-blocked Write call.
 // A zero value for t means Write will not time out.
-func (rc *OneByteWriteConn) SetWriteDeadline(t time.Time) error {
+func (rc *ChunkedWriteConn) SetWriteDeadline(t time.Time) error {
 	return rc.conn.SetWriteDeadline(t)
 }
 
 // SetReadDeadline sets the deadline for future Read calls
-func (rc *OneByteWriteConn) SetReadDeadline(t time.Time) error {
+func (rc *ChunkedWriteConn) SetReadDeadline(t time.Time) error {
 	return rc.conn.SetReadDeadline(t)
 }
 
-type OneByteReadConn struct {
+// ChunkedReadConn reads at most chunkSize bytes per Read call.
+type ChunkedReadConn struct {
 	reader io.Reader
 	conn   net.Conn
 }
 
+// NewChunkedReadConn creates a new ChunkedReadConn that reads at most
+// chunkSize bytes from conn per Read call.
+func NewChunkedReadConn(conn net.Conn, chunkSize int) *ChunkedReadConn {
+	return &ChunkedReadConn{
+		conn:   conn,
+		reader: ChunkReader(conn, chunkSize),
+	}
+}
+
 // Read reads data from the connection.
 // Read can be made to time out and return an Error with Timeout() == true
 // after a fixed time limit; see SetDeadline and SetReadDeadline.
-func (rc *OneByteReadConn) Read(b []byte) (n int, err error) {
+func (rc *ChunkedReadConn) Read(b []byte) (n int, err error) {
 	return rc.reader.Read(b)
 }
 
 // Write writes data to the connection.
 // Write can be made to time out and return an Error with Timeout() == true
 // after a fixed time limit; see SetDeadline and SetWriteDeadline.
-func (rc *OneByteReadConn) Write(b []byte) (n int, err error) {
+func (rc *ChunkedReadConn) Write(b []byte) (n int, err error) {
 	return rc.conn.Write(b)
 }
 
 // Close closes the connection.
 // Any blocked Read or Write operations will be unblocked and return errors.
-func (rc *OneByteReadConn) Close() error {
+func (rc *ChunkedReadConn) Close() error {
 	return rc.conn.Close()
 }
 
 // LocalAddr returns the local network address.
-func (rc *OneByteReadConn) LocalAddr() net.Addr {
+func (rc *ChunkedReadConn) LocalAddr() net.Addr {
 	return rc.conn.LocalAddr()
 }
 
 // RemoteAddr returns the remote network address.
-func (rc *OneByteReadConn) RemoteAddr() net.Addr {
+func (rc *ChunkedReadConn) RemoteAddr() net.Addr {
 	return rc.conn.RemoteAddr()
 }
 
@@ -148,14 +182,14 @@ func (rc *OneByteReadConn) RemoteAddr() net.Addr {
 // also return a timeout error. On Unix systems a keep-alive
 // failure on I/O can be detected using
 // errors.Is(err, syscall.ETIMEDOUT).
-func (rc *OneByteReadConn) SetDeadline(t time.Time) error {
+func (rc *ChunkedReadConn) SetDeadline(t time.Time) error {
 	return rc.conn.SetDeadline(t)
 }
 
 // SetReadDeadline sets the deadline for future Read calls
 // and any currently-blocked Read call.
 // A zero value for t means Read will not time out.
-func (rc *OneByteReadConn) SetReadDeadline(t time.Time) error {
+func (rc *ChunkedReadConn) SetReadDeadline(t time.Time) error {
 	return rc.conn.SetReadDeadline(t)
 }
 
@@ -164,20 +198,120 @@ func (rc *OneByteReadConn) SetReadDeadline(t time.Time) error {
 // Even if write times out, it may return n > 0, indicating that
 // some of the data was successfully written.
 // A zero value for t means Write will not time out.
-func (rc *OneByteReadConn) SetWriteDeadline(t time.Time) error {
+func (rc *ChunkedReadConn) SetWriteDeadline(t time.Time) error {
 	return rc.conn.SetWriteDeadline(t)
 }
 
+// OneByteWriteConn guarantees write a one bytes every time. It is a
+// ChunkedWriteConn with chunkSize 1.
+type OneByteWriteConn = ChunkedWriteConn
+
+// NewOneByteWriteConn creates a new OneByteWriteConn.
+func NewOneByteWriteConn(conn net.Conn) *OneByteWriteConn {
+	return NewChunkedWriteConn(conn, 1)
+}
+
+// OneByteReadConn reads a one byte every time. It is a ChunkedReadConn with
+// chunkSize 1.
+type OneByteReadConn = ChunkedReadConn
+
+// NewOneByteReadConn creates a new OneByteReadConn.
 func NewOneByteReadConn(conn net.Conn) *OneByteReadConn {
-	return &OneByteReadConn{
-		reader: iotest.OneByteReader(conn),
+	return NewChunkedReadConn(conn, 1)
+}
+
+// RandomChunkedWriteConn writes a randomly-sized chunk between min and max
+// bytes (inclusive) per Write call.
+type RandomChunkedWriteConn struct {
+	conn     net.Conn
+	min, max int
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// NewRandomChunkedWriteConn creates a new RandomChunkedWriteConn that writes
+// between min and max bytes to conn per Write call.
+func NewRandomChunkedWriteConn(conn net.Conn, min, max int, rng *rand.Rand) *RandomChunkedWriteConn {
+	return &RandomChunkedWriteConn{conn: conn, min: min, max: max, rng: rng}
+}
+
+// Read reads data from the connection.
+// Read can be made to time out and return an Error with Timeout() == true
+// after a fixed time limit; see SetDeadline and SetReadDeadline.
+func (rc *RandomChunkedWriteConn) Read(b []byte) (n int, err error) {
+	return rc.conn.Read(b)
+}
+
+// Write writes data to the connection.
+// Write can be made to time out and return an Error with Timeout() == true
+// after a fixed time limit; see SetDeadline and SetWriteDeadline.
+func (rc *RandomChunkedWriteConn) Write(b []byte) (n int, err error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	rc.mu.Lock()
+	size := rc.min
+	if rc.max > rc.min {
+		size += rc.rng.Intn(rc.max - rc.min + 1)
 	}
+	rc.mu.Unlock()
+
+	if size > len(b) {
+		size = len(b)
+	}
+	chunk := b[:size]
+
+	for len(chunk) > 0 {
+		nw, err := rc.conn.Write(chunk)
+		n += nw
+		if err != nil {
+			return n, err
+		}
+		chunk = chunk[nw:]
+	}
+	return n, nil
+}
+
+// Close closes the connection.
+// Any blocked Read or Write operations will be unblocked and return errors.
+func (rc *RandomChunkedWriteConn) Close() error {
+	return rc.conn.Close()
+}
+
+// LocalAddr returns the local network address.
+func (rc *RandomChunkedWriteConn) LocalAddr() net.Addr {
+	return rc.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote network address.
+func (rc *RandomChunkedWriteConn) RemoteAddr() net.Addr {
+	return rc.conn.RemoteAddr()
+}
+
+// SetDeadline sets the read and write deadlines associated with the connection.
+func (rc *RandomChunkedWriteConn) SetDeadline(t time.Time) error {
+	return rc.conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the deadline for future Read calls.
+func (rc *RandomChunkedWriteConn) SetReadDeadline(t time.Time) error {
+	return rc.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline for future Write calls.
+func (rc *RandomChunkedWriteConn) SetWriteDeadline(t time.Time) error {
+	return rc.conn.SetWriteDeadline(t)
 }
 
 // ReadDelayConn sets the read delay operations.
 type ReadDelayConn struct {
 	delay time.Duration
 	conn  net.Conn
+
+	mu           sync.Mutex
+	readDeadline time.Time
 }
 
 // NewReadDelayConn creates a new ReadDelayConn.
@@ -193,7 +327,13 @@ func NewReadDelayConn(delay time.Duration, conn net.Conn) *ReadDelayConn {
 // after a fixed time limit; see SetDeadline and SetReadDeadline.
 func (rc *ReadDelayConn) Read(b []byte) (n int, err error) {
 	if rc.delay > 0 {
-		time.Sleep(rc.delay)
+		rc.mu.Lock()
+		deadline := rc.readDeadline
+		rc.mu.Unlock()
+
+		if waitDelay(rc.delay, deadline) {
+			return 0, &net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}
+		}
 	}
 	return rc.conn.Read(b)
 }
@@ -244,6 +384,9 @@ func (rc *ReadDelayConn) RemoteAddr() net.Addr {
 // failure on I/O can be detected using
 // errors.Is(err, syscall.ETIMEDOUT).
 func (rc *ReadDelayConn) SetDeadline(t time.Time) error {
+	rc.mu.Lock()
+	rc.readDeadline = t
+	rc.mu.Unlock()
 	return rc.conn.SetDeadline(t)
 }
 
@@ -251,6 +394,9 @@ func (rc *ReadDelayConn) SetDeadline(t time.Time) error {
 // and any currently-blocked Read call.
 // A zero value for t means Read will not time out.
 func (rc *ReadDelayConn) SetReadDeadline(t time.Time) error {
+	rc.mu.Lock()
+	rc.readDeadline = t
+	rc.mu.Unlock()
 	return rc.conn.SetReadDeadline(t)
 }
 
@@ -267,6 +413,9 @@ func (rc *ReadDelayConn) SetWriteDeadline(t time.Time) error {
 type WriteDelayConn struct {
 	delay time.Duration
 	conn  net.Conn
+
+	mu            sync.Mutex
+	writeDeadline time.Time
 }
 
 // NewWriteDelayConn returns a new WriteDelayConn.
@@ -289,7 +438,13 @@ func (rc *WriteDelayConn) Read(b []byte) (n int, err error) {
 // after a fixed time limit; see SetDeadline and SetWriteDeadline.
 func (rc *WriteDelayConn) Write(b []byte) (n int, err error) {
 	if rc.delay > 0 {
-		time.Sleep(rc.delay)
+		rc.mu.Lock()
+		deadline := rc.writeDeadline
+		rc.mu.Unlock()
+
+		if waitDelay(rc.delay, deadline) {
+			return 0, &net.OpError{Op: "write", Err: os.ErrDeadlineExceeded}
+		}
 	}
 	return rc.conn.Write(b)
 }
@@ -333,6 +488,9 @@ func (rc *WriteDelayConn) RemoteAddr() net.Addr {
 // failure on I/O can be detected using
 // errors.Is(err, syscall.ETIMEDOUT).
 func (rc *WriteDelayConn) SetDeadline(t time.Time) error {
+	rc.mu.Lock()
+	rc.writeDeadline = t
+	rc.mu.Unlock()
 	return rc.conn.SetDeadline(t)
 }
 
@@ -349,6 +507,9 @@ func (rc *WriteDelayConn) SetReadDeadline(t time.Time) error {
 // some of the data was successfully written.
 // A zero value for t means Write will not time out.
 func (rc *WriteDelayConn) SetWriteDeadline(t time.Time) error {
+	rc.mu.Lock()
+	rc.writeDeadline = t
+	rc.mu.Unlock()
 	return rc.conn.SetWriteDeadline(t)
 }
 
@@ -356,6 +517,10 @@ func (rc *WriteDelayConn) SetWriteDeadline(t time.Time) error {
 type DelayConn struct {
 	delay time.Duration
 	conn  net.Conn
+
+	mu            sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
 }
 
 // NewDelayConn creates a new DelayConn.
@@ -371,7 +536,13 @@ func NewDelayConn(delay time.Duration, conn net.Conn) *DelayConn {
 // after a fixed time limit; see SetDeadline and SetReadDeadline.
 func (rc *DelayConn) Read(b []byte) (n int, err error) {
 	if rc.delay > 0 {
-		time.Sleep(rc.delay)
+		rc.mu.Lock()
+		deadline := rc.readDeadline
+		rc.mu.Unlock()
+
+		if waitDelay(rc.delay, deadline) {
+			return 0, &net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}
+		}
 	}
 	return rc.conn.Read(b)
 }
@@ -381,7 +552,13 @@ func (rc *DelayConn) Read(b []byte) (n int, err error) {
 // after a fixed time limit; see SetDeadline and SetWriteDeadline.
 func (rc *DelayConn) Write(b []byte) (n int, err error) {
 	if rc.delay > 0 {
-		time.Sleep(rc.delay)
+		rc.mu.Lock()
+		deadline := rc.writeDeadline
+		rc.mu.Unlock()
+
+		if waitDelay(rc.delay, deadline) {
+			return 0, &net.OpError{Op: "write", Err: os.ErrDeadlineExceeded}
+		}
 	}
 	return rc.conn.Write(b)
 }
@@ -425,6 +602,10 @@ func (rc *DelayConn) RemoteAddr() net.Addr {
 // failure on I/O can be detected using
 // errors.Is(err, syscall.ETIMEDOUT).
 func (rc *DelayConn) SetDeadline(t time.Time) error {
+	rc.mu.Lock()
+	rc.readDeadline = t
+	rc.writeDeadline = t
+	rc.mu.Unlock()
 	return rc.conn.SetDeadline(t)
 }
 
@@ -432,6 +613,9 @@ func (rc *DelayConn) SetDeadline(t time.Time) error {
 // and any currently-blocked Read call.
 // A zero value for t means Read will not time out.
 func (rc *DelayConn) SetReadDeadline(t time.Time) error {
+	rc.mu.Lock()
+	rc.readDeadline = t
+	rc.mu.Unlock()
 	return rc.conn.SetReadDeadline(t)
 }
 
@@ -441,5 +625,8 @@ func (rc *DelayConn) SetReadDeadline(t time.Time) error {
 // some of the data was successfully written.
 // A zero value for t means Write will not time out.
 func (rc *DelayConn) SetWriteDeadline(t time.Time) error {
+	rc.mu.Lock()
+	rc.writeDeadline = t
+	rc.mu.Unlock()
 	return rc.conn.SetWriteDeadline(t)
 }
@@ -3,6 +3,7 @@ package delayconn
 import (
 	"bytes"
 	"io"
+	"math/rand"
 	"net"
 	"testing"
 	"time"
@@ -10,6 +11,20 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+// shortWriter writes at most max bytes per Write call, regardless of how
+// many bytes are passed in, to exercise callers that must loop on short writes.
+type shortWriter struct {
+	buf *bytes.Buffer
+	max int
+}
+
+func (sw *shortWriter) Write(p []byte) (int, error) {
+	if len(p) > sw.max {
+		p = p[:sw.max]
+	}
+	return sw.buf.Write(p)
+}
+
 type rwconn struct {
 	r io.Reader
 	w io.Writer
@@ -79,14 +94,131 @@ func TestOneByteReadConn(t *testing.T) {
 	require.Equal(t, 1, n)
 }
 
-func TestPerWriteDelayConn(t *testing.T) {
-	r := bytes.NewBuffer([]byte("haha"))
+func TestReadDelayConnDeadline(t *testing.T) {
+	r := bytes.NewBuffer(nil)
 	w := bytes.NewBuffer(nil)
 	rwc := &rwconn{r, w}
 
-	var c [1024]byte
-	ww := NewPerWriteDelayConn(1*time.Millisecond, rwc)
-	n, err := ww.Write(c[:])
+	rc := NewReadDelayConn(1*time.Second, rwc)
+	rc.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+
+	started := time.Now()
+	_, err := rc.Read(nil)
+	elapsed := time.Since(started)
+
+	require.Error(t, err)
+	var netErr net.Error
+	require.ErrorAs(t, err, &netErr)
+	require.True(t, netErr.Timeout())
+	require.True(t, elapsed >= 80*time.Millisecond)
+	require.True(t, elapsed < 500*time.Millisecond)
+}
+
+func TestWriteDelayConnDeadline(t *testing.T) {
+	r := bytes.NewBuffer(nil)
+	w := bytes.NewBuffer(nil)
+	rwc := &rwconn{r, w}
+
+	wc := NewWriteDelayConn(1*time.Second, rwc)
+	wc.SetWriteDeadline(time.Now().Add(100 * time.Millisecond))
+
+	started := time.Now()
+	_, err := wc.Write(nil)
+	elapsed := time.Since(started)
+
+	require.Error(t, err)
+	var netErr net.Error
+	require.ErrorAs(t, err, &netErr)
+	require.True(t, netErr.Timeout())
+	require.True(t, elapsed >= 80*time.Millisecond)
+	require.True(t, elapsed < 500*time.Millisecond)
+}
+
+func TestDelayConnPastDeadline(t *testing.T) {
+	r := bytes.NewBuffer(nil)
+	w := bytes.NewBuffer(nil)
+	rwc := &rwconn{r, w}
+
+	dc := NewDelayConn(1*time.Second, rwc)
+	dc.SetDeadline(time.Now().Add(-1 * time.Second))
+
+	started := time.Now()
+	_, err := dc.Read(nil)
+	elapsed := time.Since(started)
+
+	require.Error(t, err)
+	require.True(t, elapsed < 50*time.Millisecond)
+}
+
+func TestChunkedWriteConn(t *testing.T) {
+	r := bytes.NewBuffer(nil)
+	w := bytes.NewBuffer(nil)
+	rwc := &rwconn{r, w}
+
+	cc := NewChunkedWriteConn(rwc, 17)
+	data := make([]byte, 50)
+
+	n, err := cc.Write(data)
+	require.Nil(t, err)
+	require.Equal(t, 17, n)
+
+	n, err = cc.Write(data[17:])
+	require.Nil(t, err)
+	require.Equal(t, 17, n)
+
+	n, err = cc.Write(data[34:])
+	require.Nil(t, err)
+	require.Equal(t, 16, n)
+}
+
+func TestChunkedWriteConnShortWrite(t *testing.T) {
+	r := bytes.NewBuffer(nil)
+	w := bytes.NewBuffer(nil)
+	rwc := &rwconn{r, &shortWriter{buf: w, max: 3}}
+
+	cc := NewChunkedWriteConn(rwc, 10)
+	data := make([]byte, 10)
+
+	n, err := cc.Write(data)
+	require.Nil(t, err)
+	require.Equal(t, 10, n)
+	require.Equal(t, 10, w.Len())
+}
+
+func TestChunkedReadConn(t *testing.T) {
+	r := bytes.NewBuffer([]byte("hello world"))
+	w := bytes.NewBuffer(nil)
+	rwc := &rwconn{r, w}
+
+	cc := NewChunkedReadConn(rwc, 4)
+	var b [1024]byte
+	n, err := cc.Read(b[:])
+	require.Nil(t, err)
+	require.Equal(t, 4, n)
+}
+
+func TestChunkedWriteConnNonPositiveChunkSize(t *testing.T) {
+	r := bytes.NewBuffer(nil)
+	w := bytes.NewBuffer(nil)
+	rwc := &rwconn{r, w}
+
+	cc := NewChunkedWriteConn(rwc, 0)
+	data := make([]byte, 3)
+
+	n, err := cc.Write(data)
+	require.Nil(t, err)
+	require.Equal(t, 1, n)
+}
+
+func TestRandomChunkedWriteConn(t *testing.T) {
+	r := bytes.NewBuffer(nil)
+	w := bytes.NewBuffer(nil)
+	rwc := &rwconn{r, w}
+
+	rc := NewRandomChunkedWriteConn(rwc, 5, 10, rand.New(rand.NewSource(1)))
+	data := make([]byte, 100)
+
+	n, err := rc.Write(data)
 	require.Nil(t, err)
-	require.Equal(t, 1024, n)
+	require.True(t, n >= 5 && n <= 10)
 }
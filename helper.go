@@ -2,18 +2,72 @@ package delayconn
 
 import "io"
 
-type oneByteWriter struct {
-	w io.Writer
+type chunkWriter struct {
+	w         io.Writer
+	chunkSize int
 }
 
-// OneByteWriter returns a writer
-func OneByteWriter(w io.Writer) io.Writer {
-	return &oneByteWriter{w: w}
+// ChunkWriter returns a writer that writes at most chunkSize bytes of p to w
+// per Write call, looping internally if w itself short-writes. chunkSize is
+// clamped to at least 1, since a non-positive chunkSize would otherwise never
+// make progress.
+func ChunkWriter(w io.Writer, chunkSize int) io.Writer {
+	if chunkSize < 1 {
+		chunkSize = 1
+	}
+	return &chunkWriter{w: w, chunkSize: chunkSize}
 }
 
-func (w *oneByteWriter) Write(p []byte) (int, error) {
+func (w *chunkWriter) Write(p []byte) (n int, err error) {
 	if len(p) == 0 {
 		return 0, nil
 	}
-	return w.w.Write(p[0:1])
+
+	end := len(p)
+	if end > w.chunkSize {
+		end = w.chunkSize
+	}
+	chunk := p[:end]
+
+	for len(chunk) > 0 {
+		nw, err := w.w.Write(chunk)
+		n += nw
+		if err != nil {
+			return n, err
+		}
+		chunk = chunk[nw:]
+	}
+	return n, nil
+}
+
+type chunkReader struct {
+	r         io.Reader
+	chunkSize int
+}
+
+// ChunkReader returns a reader that reads at most chunkSize bytes from r per
+// Read call. chunkSize is clamped to at least 1, since a non-positive
+// chunkSize would otherwise never make progress.
+func ChunkReader(r io.Reader, chunkSize int) io.Reader {
+	if chunkSize < 1 {
+		chunkSize = 1
+	}
+	return &chunkReader{r: r, chunkSize: chunkSize}
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	end := len(p)
+	if end > r.chunkSize {
+		end = r.chunkSize
+	}
+	return r.r.Read(p[:end])
+}
+
+// OneByteWriter returns a writer that writes at most one byte of p to w per Write call.
+func OneByteWriter(w io.Writer) io.Writer {
+	return ChunkWriter(w, 1)
 }
@@ -0,0 +1,458 @@
+package delayconn
+
+import (
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// deadlineWaiter blocks a held packet for a delay, but wakes immediately
+// when woken by a concurrent set() instead of committing to a blind
+// time.Sleep, so a SetDeadline call made while the wait is in flight takes
+// effect right away rather than after the full delay elapses.
+type deadlineWaiter struct {
+	mu       sync.Mutex
+	deadline time.Time
+	changed  chan struct{}
+}
+
+func (dw *deadlineWaiter) init() {
+	dw.changed = make(chan struct{})
+}
+
+// set updates the deadline and wakes any in-progress wait so it can
+// re-evaluate against the new value.
+func (dw *deadlineWaiter) set(t time.Time) {
+	dw.mu.Lock()
+	dw.deadline = t
+	ch := dw.changed
+	dw.changed = make(chan struct{})
+	dw.mu.Unlock()
+	close(ch)
+}
+
+// wait blocks for delay, returning os.ErrDeadlineExceeded as soon as the
+// currently-set deadline (which may change mid-wait via set) is reached. A
+// deadline already in the past returns immediately.
+func (dw *deadlineWaiter) wait(delay time.Duration) error {
+	delayDeadline := time.Now().Add(delay)
+
+	for {
+		dw.mu.Lock()
+		deadline := dw.deadline
+		changed := dw.changed
+		dw.mu.Unlock()
+
+		wake := delayDeadline
+		byDeadline := false
+		if !deadline.IsZero() && deadline.Before(wake) {
+			wake = deadline
+			byDeadline = true
+		}
+
+		remaining := time.Until(wake)
+		if remaining <= 0 {
+			if byDeadline {
+				return os.ErrDeadlineExceeded
+			}
+			return nil
+		}
+
+		timer := time.NewTimer(remaining)
+		select {
+		case <-timer.C:
+			if byDeadline {
+				return os.ErrDeadlineExceeded
+			}
+			return nil
+		case <-changed:
+			timer.Stop()
+			continue
+		}
+	}
+}
+
+// LossyPacketConn wraps a net.PacketConn and drops packets with probability p
+// on both ReadFrom and WriteTo. A dropped WriteTo still reports n=len(b),
+// err=nil so callers behave as if the network silently ate the datagram.
+type LossyPacketConn struct {
+	p    float64
+	rng  *rand.Rand
+	mu   sync.Mutex
+	conn net.PacketConn
+}
+
+// NewLossyPacketConn creates a new LossyPacketConn dropping packets with probability p.
+func NewLossyPacketConn(p float64, rng *rand.Rand, conn net.PacketConn) *LossyPacketConn {
+	return &LossyPacketConn{p: p, rng: rng, conn: conn}
+}
+
+func (lc *LossyPacketConn) drop() bool {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	return lc.rng.Float64() < lc.p
+}
+
+// ReadFrom reads a packet from the connection, silently discarding any
+// packets chosen for loss and retrying until one survives or an error occurs.
+func (lc *LossyPacketConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	for {
+		n, addr, err = lc.conn.ReadFrom(b)
+		if err != nil || !lc.drop() {
+			return n, addr, err
+		}
+	}
+}
+
+// WriteTo writes a packet to addr, dropping it with probability p.
+func (lc *LossyPacketConn) WriteTo(b []byte, addr net.Addr) (n int, err error) {
+	if lc.drop() {
+		return len(b), nil
+	}
+	return lc.conn.WriteTo(b, addr)
+}
+
+// Close closes the connection.
+func (lc *LossyPacketConn) Close() error { return lc.conn.Close() }
+
+// LocalAddr returns the local network address.
+func (lc *LossyPacketConn) LocalAddr() net.Addr { return lc.conn.LocalAddr() }
+
+// SetDeadline sets the read and write deadlines associated with the connection.
+func (lc *LossyPacketConn) SetDeadline(t time.Time) error { return lc.conn.SetDeadline(t) }
+
+// SetReadDeadline sets the deadline for future ReadFrom calls.
+func (lc *LossyPacketConn) SetReadDeadline(t time.Time) error { return lc.conn.SetReadDeadline(t) }
+
+// SetWriteDeadline sets the deadline for future WriteTo calls.
+func (lc *LossyPacketConn) SetWriteDeadline(t time.Time) error { return lc.conn.SetWriteDeadline(t) }
+
+// JitterDistribution selects how JitterPacketConn samples a delay for each packet.
+type JitterDistribution int
+
+// Supported jitter distributions.
+const (
+	JitterNone JitterDistribution = iota
+	JitterFixed
+	JitterUniform
+	JitterNormal
+	JitterExponential
+)
+
+// JitterConfig describes the delay distribution applied by a JitterPacketConn.
+type JitterConfig struct {
+	Distribution JitterDistribution
+
+	// Fixed is the delay used when Distribution is JitterFixed.
+	Fixed time.Duration
+
+	// Lo and Hi bound the delay when Distribution is JitterUniform.
+	Lo, Hi time.Duration
+
+	// Mu and Sigma are the mean and standard deviation used when
+	// Distribution is JitterNormal. Negative samples are clamped to zero.
+	Mu, Sigma time.Duration
+
+	// Lambda is the rate parameter (in 1/second) used when Distribution is
+	// JitterExponential.
+	Lambda float64
+}
+
+func (jc JitterConfig) sample(rng *rand.Rand) time.Duration {
+	switch jc.Distribution {
+	case JitterFixed:
+		return jc.Fixed
+	case JitterUniform:
+		if jc.Hi <= jc.Lo {
+			return jc.Lo
+		}
+		return jc.Lo + time.Duration(rng.Int63n(int64(jc.Hi-jc.Lo)))
+	case JitterNormal:
+		d := jc.Mu + time.Duration(rng.NormFloat64()*float64(jc.Sigma))
+		if d < 0 {
+			d = 0
+		}
+		return d
+	case JitterExponential:
+		if jc.Lambda <= 0 {
+			return 0
+		}
+		return time.Duration(rng.ExpFloat64() / jc.Lambda * float64(time.Second))
+	default:
+		return 0
+	}
+}
+
+// JitterPacketConn wraps a net.PacketConn and delays each ReadFrom/WriteTo by
+// a duration sampled from cfg, honoring any deadline set on the connection.
+type JitterPacketConn struct {
+	cfg  JitterConfig
+	rng  *rand.Rand
+	conn net.PacketConn
+
+	mu            sync.Mutex
+	readDeadline  deadlineWaiter
+	writeDeadline deadlineWaiter
+}
+
+// NewJitterPacketConn creates a new JitterPacketConn using cfg to sample delays.
+func NewJitterPacketConn(cfg JitterConfig, rng *rand.Rand, conn net.PacketConn) *JitterPacketConn {
+	jc := &JitterPacketConn{cfg: cfg, rng: rng, conn: conn}
+	jc.readDeadline.init()
+	jc.writeDeadline.init()
+	return jc
+}
+
+// ReadFrom reads a packet from the connection after the sampled jitter delay.
+// The wait is interruptible: a SetReadDeadline/SetDeadline call made while
+// the packet is held wakes it immediately instead of oversleeping.
+func (jc *JitterPacketConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	jc.mu.Lock()
+	delay := jc.cfg.sample(jc.rng)
+	jc.mu.Unlock()
+
+	if delay > 0 {
+		if jc.readDeadline.wait(delay) != nil {
+			return 0, nil, &net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}
+		}
+	}
+	return jc.conn.ReadFrom(b)
+}
+
+// WriteTo writes a packet to addr after the sampled jitter delay. The wait is
+// interruptible: a SetWriteDeadline/SetDeadline call made while the packet is
+// held wakes it immediately instead of oversleeping.
+func (jc *JitterPacketConn) WriteTo(b []byte, addr net.Addr) (n int, err error) {
+	jc.mu.Lock()
+	delay := jc.cfg.sample(jc.rng)
+	jc.mu.Unlock()
+
+	if delay > 0 {
+		if jc.writeDeadline.wait(delay) != nil {
+			return 0, &net.OpError{Op: "write", Err: os.ErrDeadlineExceeded}
+		}
+	}
+	return jc.conn.WriteTo(b, addr)
+}
+
+// Close closes the connection.
+func (jc *JitterPacketConn) Close() error { return jc.conn.Close() }
+
+// LocalAddr returns the local network address.
+func (jc *JitterPacketConn) LocalAddr() net.Addr { return jc.conn.LocalAddr() }
+
+// SetDeadline sets the read and write deadlines associated with the connection.
+func (jc *JitterPacketConn) SetDeadline(t time.Time) error {
+	jc.readDeadline.set(t)
+	jc.writeDeadline.set(t)
+	return jc.conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the deadline for future ReadFrom calls.
+func (jc *JitterPacketConn) SetReadDeadline(t time.Time) error {
+	jc.readDeadline.set(t)
+	return jc.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline for future WriteTo calls.
+func (jc *JitterPacketConn) SetWriteDeadline(t time.Time) error {
+	jc.writeDeadline.set(t)
+	return jc.conn.SetWriteDeadline(t)
+}
+
+// reorderedPacket is a packet held by a ReorderPacketConn awaiting out-of-order delivery.
+type reorderedPacket struct {
+	b    []byte
+	addr net.Addr
+}
+
+// ReorderPacketConn wraps a net.PacketConn and holds up to size received
+// packets in an internal queue, releasing a random one (instead of the
+// oldest) on a ReadFrom when the queue is full or, otherwise, with
+// probability 1-q, so packets can be delivered out of order.
+type ReorderPacketConn struct {
+	size int
+	q    float64
+	rng  *rand.Rand
+	conn net.PacketConn
+
+	mu      sync.Mutex
+	pending []reorderedPacket
+}
+
+// NewReorderPacketConn creates a new ReorderPacketConn with the given queue
+// size and per-packet hold probability q.
+func NewReorderPacketConn(size int, q float64, rng *rand.Rand, conn net.PacketConn) *ReorderPacketConn {
+	return &ReorderPacketConn{size: size, q: q, rng: rng, conn: conn}
+}
+
+// ReadFrom returns a held packet out of order when one is available and due
+// for release, otherwise reads a new packet from the underlying connection
+// and either returns it immediately or queues it for later delivery. If the
+// underlying ReadFrom returns an error (for example because the conn was
+// closed), that error is returned and any packets still queued in pending
+// stay queued; a later ReadFrom may still deliver them.
+func (rc *ReorderPacketConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	for {
+		rc.mu.Lock()
+		if len(rc.pending) > 0 && (len(rc.pending) >= rc.size || rc.rng.Float64() >= rc.q) {
+			idx := rc.rng.Intn(len(rc.pending))
+			pkt := rc.pending[idx]
+			rc.pending = append(rc.pending[:idx], rc.pending[idx+1:]...)
+			rc.mu.Unlock()
+			return copy(b, pkt.b), pkt.addr, nil
+		}
+		rc.mu.Unlock()
+
+		n, addr, err = rc.conn.ReadFrom(b)
+		if err != nil {
+			return n, addr, err
+		}
+
+		rc.mu.Lock()
+		if len(rc.pending) < rc.size && rc.rng.Float64() < rc.q {
+			held := make([]byte, n)
+			copy(held, b[:n])
+			rc.pending = append(rc.pending, reorderedPacket{b: held, addr: addr})
+			rc.mu.Unlock()
+			continue
+		}
+		rc.mu.Unlock()
+		return n, addr, nil
+	}
+}
+
+// WriteTo writes a packet to addr. ReorderPacketConn only reorders inbound
+// packets, so writes pass through unchanged.
+func (rc *ReorderPacketConn) WriteTo(b []byte, addr net.Addr) (n int, err error) {
+	return rc.conn.WriteTo(b, addr)
+}
+
+// Close closes the connection.
+func (rc *ReorderPacketConn) Close() error { return rc.conn.Close() }
+
+// LocalAddr returns the local network address.
+func (rc *ReorderPacketConn) LocalAddr() net.Addr { return rc.conn.LocalAddr() }
+
+// SetDeadline sets the read and write deadlines associated with the connection.
+func (rc *ReorderPacketConn) SetDeadline(t time.Time) error { return rc.conn.SetDeadline(t) }
+
+// SetReadDeadline sets the deadline for future ReadFrom calls.
+func (rc *ReorderPacketConn) SetReadDeadline(t time.Time) error { return rc.conn.SetReadDeadline(t) }
+
+// SetWriteDeadline sets the deadline for future WriteTo calls.
+func (rc *ReorderPacketConn) SetWriteDeadline(t time.Time) error {
+	return rc.conn.SetWriteDeadline(t)
+}
+
+// DupPacketConn wraps a net.PacketConn and re-sends a written packet a second
+// time with probability d, simulating a network that occasionally delivers
+// duplicate datagrams.
+type DupPacketConn struct {
+	d    float64
+	rng  *rand.Rand
+	mu   sync.Mutex
+	conn net.PacketConn
+}
+
+// NewDupPacketConn creates a new DupPacketConn duplicating packets with probability d.
+func NewDupPacketConn(d float64, rng *rand.Rand, conn net.PacketConn) *DupPacketConn {
+	return &DupPacketConn{d: d, rng: rng, conn: conn}
+}
+
+// ReadFrom reads a packet from the connection.
+func (dc *DupPacketConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	return dc.conn.ReadFrom(b)
+}
+
+// WriteTo writes a packet to addr, then re-sends it with probability d.
+func (dc *DupPacketConn) WriteTo(b []byte, addr net.Addr) (n int, err error) {
+	n, err = dc.conn.WriteTo(b, addr)
+	if err != nil {
+		return n, err
+	}
+
+	dc.mu.Lock()
+	dup := dc.rng.Float64() < dc.d
+	dc.mu.Unlock()
+	if dup {
+		dc.conn.WriteTo(b, addr)
+	}
+	return n, err
+}
+
+// Close closes the connection.
+func (dc *DupPacketConn) Close() error { return dc.conn.Close() }
+
+// LocalAddr returns the local network address.
+func (dc *DupPacketConn) LocalAddr() net.Addr { return dc.conn.LocalAddr() }
+
+// SetDeadline sets the read and write deadlines associated with the connection.
+func (dc *DupPacketConn) SetDeadline(t time.Time) error { return dc.conn.SetDeadline(t) }
+
+// SetReadDeadline sets the deadline for future ReadFrom calls.
+func (dc *DupPacketConn) SetReadDeadline(t time.Time) error { return dc.conn.SetReadDeadline(t) }
+
+// SetWriteDeadline sets the deadline for future WriteTo calls.
+func (dc *DupPacketConn) SetWriteDeadline(t time.Time) error { return dc.conn.SetWriteDeadline(t) }
+
+// ChaosConfig configures a ChaosPacketConn. A zero-value field disables the
+// corresponding stage.
+type ChaosConfig struct {
+	// Seed seeds each enabled stage's own *rand.Rand (derived deterministically
+	// per stage), so a ChaosPacketConn built from the same ChaosConfig is
+	// reproducible.
+	Seed int64
+
+	// LossProbability is the packet drop probability. Zero disables loss.
+	LossProbability float64
+
+	// Jitter configures delivery delay. A zero Distribution disables jitter.
+	Jitter JitterConfig
+
+	// ReorderSize and ReorderHoldProbability configure the reorder queue.
+	// Either being zero disables reordering.
+	ReorderSize            int
+	ReorderHoldProbability float64
+
+	// DupProbability is the packet duplication probability. Zero disables duplication.
+	DupProbability float64
+}
+
+// ChaosPacketConn composes Dup, Reorder, Jitter, and Loss wrappers (applied
+// in that order, innermost to outermost) over a net.PacketConn.
+type ChaosPacketConn struct {
+	net.PacketConn
+}
+
+// NewChaosPacketConn builds a ChaosPacketConn around pc according to cfg,
+// stacking the enabled stages in a deterministic order. Each stage gets its
+// own *rand.Rand derived from cfg.Seed rather than sharing one: math/rand.Rand
+// is not safe for concurrent use, and a net.PacketConn's ReadFrom/WriteTo are
+// commonly called from different goroutines, so a single shared *rand.Rand
+// touched by both the read-side and write-side stages would race.
+func NewChaosPacketConn(cfg ChaosConfig, pc net.PacketConn) *ChaosPacketConn {
+	stage := int64(0)
+	stageRand := func() *rand.Rand {
+		stage++
+		return rand.New(rand.NewSource(cfg.Seed + stage))
+	}
+
+	var wrapped net.PacketConn = pc
+	if cfg.DupProbability > 0 {
+		wrapped = NewDupPacketConn(cfg.DupProbability, stageRand(), wrapped)
+	}
+	if cfg.ReorderSize > 0 && cfg.ReorderHoldProbability > 0 {
+		wrapped = NewReorderPacketConn(cfg.ReorderSize, cfg.ReorderHoldProbability, stageRand(), wrapped)
+	}
+	if cfg.Jitter.Distribution != JitterNone {
+		wrapped = NewJitterPacketConn(cfg.Jitter, stageRand(), wrapped)
+	}
+	if cfg.LossProbability > 0 {
+		wrapped = NewLossyPacketConn(cfg.LossProbability, stageRand(), wrapped)
+	}
+
+	return &ChaosPacketConn{PacketConn: wrapped}
+}
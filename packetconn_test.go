@@ -0,0 +1,124 @@
+package delayconn
+
+import (
+	"io"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakePacketConn serves a fixed queue of packets to ReadFrom and records
+// everything passed to WriteTo.
+type fakePacketConn struct {
+	queue   [][]byte
+	written [][]byte
+}
+
+func (fc *fakePacketConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	if len(fc.queue) == 0 {
+		return 0, nil, io.EOF
+	}
+	pkt := fc.queue[0]
+	fc.queue = fc.queue[1:]
+	return copy(b, pkt), &net.UDPAddr{}, nil
+}
+
+func (fc *fakePacketConn) WriteTo(b []byte, addr net.Addr) (n int, err error) {
+	cp := make([]byte, len(b))
+	copy(cp, b)
+	fc.written = append(fc.written, cp)
+	return len(b), nil
+}
+
+func (fc *fakePacketConn) Close() error                       { return nil }
+func (fc *fakePacketConn) LocalAddr() net.Addr                { return &net.UDPAddr{} }
+func (fc *fakePacketConn) SetDeadline(t time.Time) error      { return nil }
+func (fc *fakePacketConn) SetReadDeadline(t time.Time) error  { return nil }
+func (fc *fakePacketConn) SetWriteDeadline(t time.Time) error { return nil }
+
+func TestLossyPacketConnWriteTo(t *testing.T) {
+	fc := &fakePacketConn{}
+	lc := NewLossyPacketConn(1, rand.New(rand.NewSource(1)), fc)
+
+	n, err := lc.WriteTo([]byte("hello"), &net.UDPAddr{})
+	require.NoError(t, err)
+	require.Equal(t, 5, n)
+	require.Len(t, fc.written, 0)
+}
+
+func TestJitterPacketConnDeadline(t *testing.T) {
+	fc := &fakePacketConn{queue: [][]byte{[]byte("x")}}
+	jc := NewJitterPacketConn(JitterConfig{Distribution: JitterFixed, Fixed: time.Second}, rand.New(rand.NewSource(1)), fc)
+	jc.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+
+	started := time.Now()
+	var b [16]byte
+	_, _, err := jc.ReadFrom(b[:])
+	elapsed := time.Since(started)
+
+	require.Error(t, err)
+	require.True(t, elapsed < 500*time.Millisecond)
+}
+
+func TestJitterPacketConnDeadlineSetMidWait(t *testing.T) {
+	fc := &fakePacketConn{queue: [][]byte{[]byte("x")}}
+	jc := NewJitterPacketConn(JitterConfig{Distribution: JitterFixed, Fixed: time.Second}, rand.New(rand.NewSource(1)), fc)
+
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		jc.SetReadDeadline(time.Now())
+	}()
+
+	started := time.Now()
+	var b [16]byte
+	_, _, err := jc.ReadFrom(b[:])
+	elapsed := time.Since(started)
+
+	require.Error(t, err)
+	require.True(t, elapsed < 200*time.Millisecond)
+}
+
+func TestDupPacketConnAlwaysDuplicates(t *testing.T) {
+	fc := &fakePacketConn{}
+	dc := NewDupPacketConn(1, rand.New(rand.NewSource(1)), fc)
+
+	_, err := dc.WriteTo([]byte("hi"), &net.UDPAddr{})
+	require.NoError(t, err)
+	require.Len(t, fc.written, 2)
+}
+
+func TestChaosPacketConnReproducible(t *testing.T) {
+	cfg := ChaosConfig{Seed: 42, LossProbability: 0.5}
+
+	fc1 := &fakePacketConn{}
+	fc2 := &fakePacketConn{}
+	for i := 0; i < 20; i++ {
+		fc1.queue = append(fc1.queue, []byte{byte(i)})
+		fc2.queue = append(fc2.queue, []byte{byte(i)})
+	}
+
+	cc1 := NewChaosPacketConn(cfg, fc1)
+	cc2 := NewChaosPacketConn(cfg, fc2)
+
+	var reads1, reads2 int
+	var b [16]byte
+	for {
+		_, _, err := cc1.ReadFrom(b[:])
+		if err != nil {
+			break
+		}
+		reads1++
+	}
+	for {
+		_, _, err := cc2.ReadFrom(b[:])
+		if err != nil {
+			break
+		}
+		reads2++
+	}
+
+	require.Equal(t, reads1, reads2)
+}